@@ -5,11 +5,15 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"go/ast"
+	"go/printer"
 	"go/token"
 	"go/types"
+	"path"
+	"strings"
 
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/passes/inspect"
@@ -18,11 +22,15 @@ import (
 )
 
 var flagAssign = flag.Bool("assign", false, "warn about assignments of *ir.Name to ir.Node (beware: many false positives)")
+var flagInterproc = flag.Bool("interproc", false, "warn about ir.Node vars/params/results only ever assigned *ir.Name, tracked across the whole pass")
 
-const Doc = `check for suspicious cmd/compile constructs
+const Doc = `check for suspicious narrowed-interface constructs
 
-The gclint analyzer reports reports about uses of ir.Node that are
-suspect and likely need changes to allow introducing ir.IdentExpr.`
+The gclint analyzer reports uses of an interface type that are suspect
+and likely need changes to narrow them to the concrete type they're
+really holding. By default it looks for the cmd/compile ir.Node ->
+*ir.Name narrowing, but other checks can be configured with -rules; see
+the Rule type for details.`
 
 var Analyzer = &analysis.Analyzer{
 	Name:     "gclint",
@@ -36,6 +44,8 @@ func main() {
 }
 
 func run(pass *analysis.Pass) (interface{}, error) {
+	rules := activeRules()
+
 	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
 	inspect.WithStack(nil, func(n ast.Node, push bool, stack []ast.Node) (proceed bool) {
 		if !push {
@@ -44,50 +54,382 @@ func run(pass *analysis.Pass) (interface{}, error) {
 
 		info := pass.TypesInfo
 
-		switch n := n.(type) {
-		case *ast.MapType:
-			if isNodeType(info.Types[n.Key].Type) {
-				pass.Reportf(n.Pos(), "map with ir.Node key (likely change key type to *ir.Name)")
-			}
+		for _, rule := range rules {
+			switch n := n.(type) {
+			case *ast.MapType:
+				if rule.isInterface(info.Types[n.Key].Type) {
+					pass.Report(analysis.Diagnostic{
+						Pos:     n.Pos(),
+						Message: fmt.Sprintf("map with %s key (likely change key type to %s)", rule.interfaceName(), rule.concreteName()),
+						SuggestedFixes: []analysis.SuggestedFix{
+							retypeFix(fmt.Sprintf("Change key type to %s", rule.concreteName()), n.Key, rule),
+						},
+					})
+				}
 
-		case *ast.BinaryExpr:
-			if n.Op == token.EQL || n.Op == token.NEQ {
-				xtv := info.Types[n.X]
-				ytv := info.Types[n.Y]
+			case *ast.Field:
+				if len(stack) >= 3 {
+					if _, ok := stack[len(stack)-3].(*ast.StructType); ok {
+						if rule.isInterface(info.Types[n.Type].Type) {
+							pass.Report(analysis.Diagnostic{
+								Pos:     n.Pos(),
+								Message: fmt.Sprintf("struct field typed as %s (likely change to %s)", rule.interfaceName(), rule.concreteName()),
+								SuggestedFixes: []analysis.SuggestedFix{
+									retypeFix(fmt.Sprintf("Change field type to %s", rule.concreteName()), n.Type, rule),
+								},
+							})
+						}
+					}
+				}
 
-				// Comparison with nil is always safe.
-				if xtv.IsNil() || ytv.IsNil() {
-					break
+			case *ast.BinaryExpr:
+				if n.Op == token.EQL || n.Op == token.NEQ {
+					xtv := info.Types[n.X]
+					ytv := info.Types[n.Y]
+
+					// Comparison with nil is always safe.
+					if xtv.IsNil() || ytv.IsNil() {
+						break
+					}
+
+					// Quick hack. What we really want to
+					// do here is check if *Concrete is
+					// *not* assignable to either operand.
+					if rule.isExemptPtr(xtv.Type) || rule.isExemptPtr(ytv.Type) {
+						break
+					}
+
+					if rule.isInterface(xtv.Type) {
+						msg := fmt.Sprintf("comparison of %s values", rule.interfaceName())
+						var fixes []analysis.SuggestedFix
+						if rule.CompareFunc != "" {
+							compareName := fmt.Sprintf("%s.%s", path.Base(rule.PkgPath), rule.CompareFunc)
+							repl := fmt.Sprintf("%s(%s, %s)", compareName, printNode(pass.Fset, n.X), printNode(pass.Fset, n.Y))
+							fixMsg := "Replace with " + compareName
+							if n.Op == token.NEQ {
+								repl = "!" + repl
+								fixMsg = "Replace with negated " + compareName
+							}
+
+							alternatives := make([]string, 0, len(rule.CompareAlternatives)+1)
+							for _, alt := range rule.CompareAlternatives {
+								alternatives = append(alternatives, fmt.Sprintf("%s.%s", path.Base(rule.PkgPath), alt))
+							}
+							alternatives = append(alternatives, compareName)
+							msg += fmt.Sprintf(" (replace with %s)", strings.Join(alternatives, " or "))
+
+							fixes = []analysis.SuggestedFix{{
+								Message:   fixMsg,
+								TextEdits: []analysis.TextEdit{{Pos: n.Pos(), End: n.End(), NewText: []byte(repl)}},
+							}}
+						}
+
+						pass.Report(analysis.Diagnostic{Pos: n.Pos(), Message: msg, SuggestedFixes: fixes})
+					}
 				}
 
-				// Quick hack. What we really want to
-				// do here is check if *ir.Name is
-				// *not* assignable to either operand.
-				if isPtrToFuncType(xtv.Type) || isPtrToFuncType(ytv.Type) {
-					break
+			case *ast.TypeAssertExpr:
+				if n.Type != nil && rule.isInterface(info.Types[n.X].Type) && rule.isPtrToConcrete(info.Types[n.Type].Type) {
+					pass.Reportf(n.Pos(), "type assertion of %s to %s (caller should hold %s directly instead)", rule.interfaceName(), rule.concreteName(), rule.concreteName())
 				}
 
-				if isNodeType(xtv.Type) {
-					pass.Reportf(n.Pos(), "comparison of ir.Node values (replace with ir.Uses or ir.SameSource)")
+			case *ast.TypeSwitchStmt:
+				if x := typeSwitchGuardX(n); x != nil && rule.isInterface(info.Types[x].Type) {
+					for _, stmt := range n.Body.List {
+						clause := stmt.(*ast.CaseClause)
+						for _, expr := range clause.List {
+							if rule.isPtrToConcrete(info.Types[expr].Type) {
+								pass.Reportf(expr.Pos(), "type switch case %s on %s value (caller should hold %s directly instead)", rule.concreteName(), rule.interfaceName(), rule.concreteName())
+							}
+						}
+					}
 				}
 			}
-		}
 
-		if *flagAssign {
-			if n, ok := n.(ast.Expr); ok {
-				tv := info.Types[n]
-				if tv.IsValue() && isPtrToNameType(tv.Type) && assignedToNode(stack, info) {
-					pass.Reportf(n.Pos(), "*ir.Name assigned to ir.Node (maybe change destination to *ir.Name too)")
+			if *flagAssign {
+				if n, ok := n.(ast.Expr); ok {
+					tv := info.Types[n]
+					if tv.IsValue() && rule.isPtrToConcrete(tv.Type) {
+						if obj, ok := assignedToNode(stack, info, rule); ok {
+							diag := analysis.Diagnostic{
+								Pos:     n.Pos(),
+								Message: fmt.Sprintf("%s assigned to %s (maybe change destination to %s too)", rule.concreteName(), rule.interfaceName(), rule.concreteName()),
+							}
+							if obj != nil {
+								if typeExpr := findDeclType(pass, obj); typeExpr != nil {
+									diag.SuggestedFixes = []analysis.SuggestedFix{
+										retypeFix(fmt.Sprintf("Change destination type to %s", rule.concreteName()), typeExpr, rule),
+									}
+								}
+							}
+							pass.Report(diag)
+						}
+					}
 				}
 			}
 		}
 
 		return true
 	})
+
+	if *flagInterproc {
+		for _, rule := range rules {
+			runInterproc(pass, inspect, rule)
+		}
+	}
+
 	return nil, nil
 }
 
-func assignedToNode(stack []ast.Node, info *types.Info) bool {
+// nodeVarState tracks, for a single Interface-typed types.Var, whether
+// every RHS value it has been observed to be assigned is *Concrete or nil.
+type nodeVarState struct {
+	demoted  bool // observed at least one non-*Concrete, non-nil RHS
+	onlyName bool // observed at least one *Concrete or nil RHS, and not demoted
+}
+
+// runInterproc implements the -interproc flow mode: a conservative, pass-wide
+// def-use sweep that flags any rule.Interface-typed variable, parameter, or
+// result that is only ever assigned *rule.Concrete values (or nil), even
+// when that flows through a local variable or across a call boundary within
+// the pass.
+//
+// This is necessarily approximate: it only tracks types.Var objects through
+// assignments, var declarations, and call/return bindings. Struct fields
+// are seen only when assigned through a selector (composite literal entries
+// are not seen), and slice elements are not tracked at all. Demotion is
+// permanent and monotonic, so a var is never un-demoted once a
+// disqualifying assignment is seen.
+func runInterproc(pass *analysis.Pass, inspect *inspector.Inspector, rule Rule) {
+	info := pass.TypesInfo
+	states := map[*types.Var]*nodeVarState{}
+
+	note := func(v *types.Var, typ types.Type, isNil bool) {
+		if v == nil || !rule.isInterface(v.Type()) || !declaredInPass(pass, v.Pos()) {
+			return
+		}
+		st := states[v]
+		if st == nil {
+			st = &nodeVarState{}
+			states[v] = st
+		}
+		if st.demoted {
+			return
+		}
+		if isNil || rule.isPtrToConcrete(typ) {
+			st.onlyName = true
+			return
+		}
+		st.demoted = true
+		st.onlyName = false
+	}
+
+	demote := func(v *types.Var) {
+		if v == nil || !rule.isInterface(v.Type()) || !declaredInPass(pass, v.Pos()) {
+			return
+		}
+		st := states[v]
+		if st == nil {
+			st = &nodeVarState{}
+			states[v] = st
+		}
+		st.demoted = true
+		st.onlyName = false
+	}
+
+	inspect.WithStack(nil, func(n ast.Node, push bool, stack []ast.Node) (proceed bool) {
+		if !push {
+			return true
+		}
+
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) == len(n.Rhs) {
+				for i, lhs := range n.Lhs {
+					// Assignments to allowed fields (e.g.
+					// Name.Defn) are okay for now; see the
+					// single-function pass's identical
+					// exemption in assignedToNode.
+					if rule.isAllowedField(lhs, info) {
+						continue
+					}
+					v, _ := lvalObject(lhs, info).(*types.Var)
+					tv := info.Types[n.Rhs[i]]
+					note(v, tv.Type, tv.IsNil())
+				}
+			} else {
+				// E.g. "a, b = f()": too conservative
+				// to track precisely, so demote.
+				for _, lhs := range n.Lhs {
+					if rule.isAllowedField(lhs, info) {
+						continue
+					}
+					v, _ := lvalObject(lhs, info).(*types.Var)
+					demote(v)
+				}
+			}
+
+		case *ast.ValueSpec:
+			switch {
+			case len(n.Values) == 0:
+				for _, name := range n.Names {
+					v, _ := info.Defs[name].(*types.Var)
+					note(v, nil, true)
+				}
+			case len(n.Values) == len(n.Names):
+				for i, name := range n.Names {
+					v, _ := info.Defs[name].(*types.Var)
+					tv := info.Types[n.Values[i]]
+					note(v, tv.Type, tv.IsNil())
+				}
+			default:
+				for _, name := range n.Names {
+					v, _ := info.Defs[name].(*types.Var)
+					demote(v)
+				}
+			}
+
+		case *ast.CallExpr:
+			sig, ok := info.Types[n.Fun].Type.(*types.Signature)
+			if !ok {
+				break
+			}
+			nparams := sig.Params().Len()
+			for i, arg := range n.Args {
+				tv := info.Types[arg]
+
+				if sig.Variadic() && !n.Ellipsis.IsValid() && i >= nparams-1 {
+					elem, ok := sig.Params().At(nparams - 1).Type().(*types.Slice)
+					if ok && rule.isInterface(elem.Elem()) {
+						note(sig.Params().At(nparams-1), tv.Type, tv.IsNil())
+					}
+					continue
+				}
+				if i < nparams {
+					note(sig.Params().At(i), tv.Type, tv.IsNil())
+				}
+			}
+
+		case *ast.ReturnStmt:
+			sig, ok := funcScope(stack, info).(*types.Signature)
+			if !ok || len(n.Results) != sig.Results().Len() {
+				break
+			}
+			for i, res := range n.Results {
+				tv := info.Types[res]
+				note(sig.Results().At(i), tv.Type, tv.IsNil())
+			}
+		}
+		return true
+	})
+
+	for v, st := range states {
+		if st.onlyName && !st.demoted {
+			pass.Reportf(v.Pos(), "%s is %s but only ever assigned %s (likely change its type to %s)", v.Name(), rule.interfaceName(), rule.concreteName(), rule.concreteName())
+		}
+	}
+}
+
+// typeSwitchGuardX returns the X operand of the type assertion guarding sw
+// (i.e. the v in "switch v := x.(type)" or "switch x.(type)"), or nil if it
+// can't be determined.
+func typeSwitchGuardX(sw *ast.TypeSwitchStmt) ast.Expr {
+	var assert *ast.TypeAssertExpr
+	switch a := sw.Assign.(type) {
+	case *ast.ExprStmt:
+		assert, _ = a.X.(*ast.TypeAssertExpr)
+	case *ast.AssignStmt:
+		if len(a.Rhs) == 1 {
+			assert, _ = a.Rhs[0].(*ast.TypeAssertExpr)
+		}
+	}
+	if assert == nil {
+		return nil
+	}
+	return assert.X
+}
+
+// retypeFix returns a SuggestedFix that replaces typeExpr with *rule.Concrete.
+func retypeFix(message string, typeExpr ast.Expr, rule Rule) analysis.SuggestedFix {
+	return analysis.SuggestedFix{
+		Message:   message,
+		TextEdits: []analysis.TextEdit{{Pos: typeExpr.Pos(), End: typeExpr.End(), NewText: []byte(rule.concreteName())}},
+	}
+}
+
+// printNode renders n as Go source text.
+func printNode(fset *token.FileSet, n ast.Node) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, n)
+	return buf.String()
+}
+
+// declaredInPass reports whether pos falls within one of pass.Files, i.e.
+// whether the object at pos was declared in the package being analyzed
+// rather than an imported one. runInterproc uses this to avoid reporting
+// (or tracking) types.Vars it only observed partially, from call sites in
+// this package, because they belong to some other package entirely.
+func declaredInPass(pass *analysis.Pass, pos token.Pos) bool {
+	for _, f := range pass.Files {
+		if f.Pos() <= pos && pos < f.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// findDeclType locates the declaration of obj (a struct field, parameter,
+// result, or package-level variable) among pass.Files and returns its type
+// expression, so that a SuggestedFix can target the declaration site. It
+// returns nil if obj wasn't declared in a file being analyzed, e.g. because
+// it came from another package.
+func findDeclType(pass *analysis.Pass, obj types.Object) ast.Expr {
+	pos := obj.Pos()
+
+	var found ast.Expr
+	for _, f := range pass.Files {
+		if !(f.Pos() <= pos && pos < f.End()) {
+			continue
+		}
+
+		ast.Inspect(f, func(n ast.Node) bool {
+			if found != nil {
+				return false
+			}
+
+			var names []*ast.Ident
+			var typ ast.Expr
+			switch n := n.(type) {
+			case *ast.Field:
+				names, typ = n.Names, n.Type
+			case *ast.ValueSpec:
+				names, typ = n.Names, n.Type
+			default:
+				return true
+			}
+
+			for _, name := range names {
+				if name.Pos() == pos {
+					found = typ
+					return false
+				}
+			}
+			return true
+		})
+
+		if found != nil {
+			break
+		}
+	}
+	return found
+}
+
+// assignedToNode reports whether n (found at the top of stack) is assigned
+// to a destination of (static) type rule.Interface. When it returns true,
+// obj is the types.Object declaring that destination, if one could be
+// identified (e.g. for use by findDeclType to locate a SuggestedFix
+// target); obj may be nil even when ok is true.
+func assignedToNode(stack []ast.Node, info *types.Info, rule Rule) (obj types.Object, ok bool) {
 	n := stack[len(stack)-1]
 	parent := stack[len(stack)-2]
 
@@ -97,22 +439,25 @@ func assignedToNode(stack []ast.Node, info *types.Info) bool {
 			if rhs == n {
 				lval := parent.Lhs[i]
 
-				// Assignments to Name.Defn are okay
-				// for now; they're used for linking
-				// up closure variables to the outer
-				// context.
-				if isNameDefnField(lval, info) {
-					return false
+				// Assignments to allowed fields (e.g.
+				// Name.Defn) are okay for now; they're
+				// used for linking up closure variables
+				// to the outer context.
+				if rule.isAllowedField(lval, info) {
+					return nil, false
 				}
 
-				return isNodeType(info.Types[lval].Type)
+				if !rule.isInterface(info.Types[lval].Type) {
+					return nil, false
+				}
+				return lvalObject(lval, info), true
 			}
 		}
 
 	case *ast.CallExpr:
 		tv := info.Types[parent.Fun]
 		if !tv.IsValue() {
-			return false
+			return nil, false
 		}
 		sig := tv.Type.(*types.Signature)
 		nparams := sig.Params().Len()
@@ -120,24 +465,112 @@ func assignedToNode(stack []ast.Node, info *types.Info) bool {
 		for i, arg := range parent.Args {
 			if arg == n {
 				if sig.Variadic() && !parent.Ellipsis.IsValid() && i >= nparams-1 {
-					return isNodeType(sig.Params().At(nparams - 1).Type().(*types.Slice).Elem())
+					param := sig.Params().At(nparams - 1)
+					if !rule.isInterface(param.Type().(*types.Slice).Elem()) {
+						return nil, false
+					}
+					return param, true
 				}
-				return isNodeType(sig.Params().At(i).Type())
+				param := sig.Params().At(i)
+				if !rule.isInterface(param.Type()) {
+					return nil, false
+				}
+				return param, true
 			}
 		}
 		panic(fmt.Sprintf("didn't find %v in %v", n, parent))
 
 	case *ast.ReturnStmt:
-		typ := funcScope(stack, info).(*types.Signature).Results()
+		results := funcScope(stack, info).(*types.Signature).Results()
 		for i, res := range parent.Results {
 			if res == n {
-				return isNodeType(typ.At(i).Type())
+				result := results.At(i)
+				if !rule.isInterface(result.Type()) {
+					return nil, false
+				}
+				return result, true
 			}
 		}
 		panic(fmt.Sprintf("didn't find %v in %v", n, parent))
+
+	case *ast.CompositeLit:
+		// Positional element: T{..., n, ...}.
+		elt := n.(ast.Expr)
+		if field := compositeEltField(parent, elt, info); field != nil && rule.isInterface(field.Type()) {
+			return field, true
+		}
+
+	case *ast.KeyValueExpr:
+		// Keyed element: T{Field: n, ...}.
+		if len(stack) >= 3 && parent.Value == n {
+			if lit, ok := stack[len(stack)-3].(*ast.CompositeLit); ok {
+				if field := compositeEltField(lit, parent, info); field != nil && rule.isInterface(field.Type()) {
+					return field, true
+				}
+			}
+		}
 	}
 
-	return false
+	return nil, false
+}
+
+// lvalObject returns the types.Object that lval (the LHS of an assignment)
+// refers to, or nil if it can't be determined.
+func lvalObject(lval ast.Expr, info *types.Info) types.Object {
+	switch lval := lval.(type) {
+	case *ast.Ident:
+		if obj := info.Uses[lval]; obj != nil {
+			return obj
+		}
+		return info.Defs[lval]
+	case *ast.SelectorExpr:
+		return info.Uses[lval.Sel]
+	}
+	return nil
+}
+
+// compositeEltField returns the struct field that elt (either a bare value
+// or a *ast.KeyValueExpr) initializes within lit, or nil if it can't be
+// determined (e.g. lit isn't a struct literal).
+func compositeEltField(lit *ast.CompositeLit, elt ast.Expr, info *types.Info) *types.Var {
+	styp := underlyingStruct(info.Types[lit].Type)
+	if styp == nil {
+		return nil
+	}
+
+	if kv, ok := elt.(*ast.KeyValueExpr); ok {
+		ident, ok := kv.Key.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		for i := 0; i < styp.NumFields(); i++ {
+			if styp.Field(i).Name() == ident.Name {
+				return styp.Field(i)
+			}
+		}
+		return nil
+	}
+
+	for i, e := range lit.Elts {
+		if e == elt {
+			if i < styp.NumFields() {
+				return styp.Field(i)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func underlyingStruct(typ types.Type) *types.Struct {
+	if typ == nil {
+		return nil
+	}
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+	styp, _ := typ.Underlying().(*types.Struct)
+	return styp
 }
 
 func funcScope(stack []ast.Node, info *types.Info) types.Type {
@@ -152,22 +585,6 @@ func funcScope(stack []ast.Node, info *types.Info) types.Type {
 	panic(fmt.Sprintf("no enclosing function declaration or literal"))
 }
 
-const irPkgPath = "cmd/compile/internal/ir"
-
-func isNameDefnField(n ast.Expr, info *types.Info) bool {
-	if sel, ok := n.(*ast.SelectorExpr); ok {
-		obj, ok := info.Uses[sel.Sel]
-		// TODO(mdempsky): This is imprecise. Should really
-		// check that obj is a field declared within ir.Name.
-		return ok && isNamedObject(obj, irPkgPath, "Defn")
-	}
-	return false
-}
-
-func isPtrToFuncType(typ types.Type) bool { return isPtrToNamedType(typ, irPkgPath, "Func") }
-func isPtrToNameType(typ types.Type) bool { return isPtrToNamedType(typ, irPkgPath, "Name") }
-func isNodeType(typ types.Type) bool      { return isNamedType(typ, irPkgPath, "Node") }
-
 func isPtrToNamedType(typ types.Type, pkgPath, name string) bool {
 	ptr, ok := typ.(*types.Pointer)
 	return ok && isNamedType(ptr.Elem(), pkgPath, name)
@@ -0,0 +1,48 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func init() {
+	// The real cmd/compile/internal/ir can't be imported from testdata
+	// (it's an internal package, and our fixture GOPATH isn't rooted
+	// under cmd/compile), so point DefaultRule at a fixture package that
+	// mirrors ir.Node/*ir.Name/*ir.Func instead.
+	DefaultRule.PkgPath = "gclinttest/ir"
+}
+
+// TestDefault checks the default-rule diagnostics (map keys, struct
+// fields, comparisons, type assertions, and type switches) with neither
+// -assign nor -interproc set.
+func TestDefault(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "a")
+}
+
+// TestAssign checks the -assign mode, including assignment to a
+// composite literal element (the case assignedToNode's *ast.CompositeLit
+// branch handles).
+func TestAssign(t *testing.T) {
+	*flagAssign = true
+	defer func() { *flagAssign = false }()
+
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "assign")
+}
+
+// TestInterproc checks the -interproc mode: that it tracks a var flagged
+// through a local assignment, that it doesn't flag a callee's parameter
+// based on call sites in a different package (package b's UseNode, only
+// ever called with *ir.Name from package c), and that it reports nothing
+// for an assignment through Name.Defn (package d).
+func TestInterproc(t *testing.T) {
+	*flagInterproc = true
+	defer func() { *flagInterproc = false }()
+
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "b", "c", "d")
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"log"
+	"os"
+	"path"
+	"sync"
+)
+
+var flagRules = flag.String("rules", "", "path to a JSON file containing a []Rule describing the interface/concrete narrowing checks to run (default: the cmd/compile ir.Node/ir.Name rule)")
+
+// FieldRef identifies a named struct field that is allowed to hold a
+// Concrete-typed value even though code elsewhere assigns it through an
+// Interface-typed destination (e.g. ir.Name.Defn, which links closure
+// variables back to their outer-scope counterpart).
+type FieldRef struct {
+	Type  string // name of the type declaring the field, e.g. "Name"
+	Field string // field name, e.g. "Defn"
+}
+
+// Rule describes one interface -> concrete-type narrowing problem for the
+// analyzer to look for: places where an Interface-typed map key, struct
+// field, comparison, or assignment could only ever involve a *Concrete
+// value, and so should likely be narrowed to *Concrete instead.
+//
+// The default rule set (used when -rules isn't given) looks for the
+// cmd/compile/internal/ir.Node -> *ir.Name narrowing that motivated this
+// tool, but the same checks apply to any analogous problem, e.g. narrowing
+// ast.Node to *ast.Ident, or ssa.Value to *ssa.Parameter.
+type Rule struct {
+	PkgPath   string // import path declaring Interface and Concrete
+	Interface string // interface type name, e.g. "Node"
+	Concrete  string // concrete type name, e.g. "Name" (used as *Concrete)
+
+	// ExemptPtrTo lists additional *T types (T declared in PkgPath) that
+	// should never be flagged, even though they're also assignable to
+	// Interface (e.g. *ir.Func, which is fine to compare directly).
+	ExemptPtrTo []string
+
+	// AllowedFields lists fields that may be assigned a *Concrete value
+	// through an Interface-typed destination without being flagged.
+	AllowedFields []FieldRef
+
+	// CompareFunc, if set, names a PkgPath function with signature
+	// func(Interface, Interface) bool that the analyzer should suggest
+	// in place of a == or != comparison between two Interface values.
+	CompareFunc string
+
+	// CompareAlternatives lists additional PkgPath function names that
+	// are also acceptable replacements for a == or != comparison, listed
+	// in the diagnostic message alongside CompareFunc for context; no
+	// SuggestedFix is offered for them. For example, cmd/compile's
+	// ir.Node comparisons can also be replaced with ir.Uses, depending
+	// on what the caller is really asking.
+	CompareAlternatives []string
+}
+
+// DefaultRule is the Rule used when -rules isn't given (alongside any rules
+// registered with RegisterRule): the cmd/compile ir.Node -> *ir.Name
+// narrowing that this tool was originally written for.
+var DefaultRule = Rule{
+	PkgPath:     "cmd/compile/internal/ir",
+	Interface:   "Node",
+	Concrete:    "Name",
+	ExemptPtrTo: []string{"Func"},
+	AllowedFields: []FieldRef{
+		{Type: "Name", Field: "Defn"},
+	},
+	CompareFunc:         "SameSource",
+	CompareAlternatives: []string{"Uses"},
+}
+
+// extraRules are Rules registered via RegisterRule, for callers that embed
+// Analyzer as a library rather than running gclint as a standalone command.
+var extraRules []Rule
+
+// RegisterRule adds r to the set of rules the analyzer checks, in addition
+// to whatever -rules configures (or DefaultRule, if -rules is unset). It's
+// meant to be called from an init function by a program embedding Analyzer.
+func RegisterRule(r Rule) {
+	extraRules = append(extraRules, r)
+}
+
+var (
+	rulesOnce sync.Once
+	rules     []Rule
+)
+
+// activeRules returns the Rules to check, loading -rules (or falling back
+// to DefaultRule) on first use.
+func activeRules() []Rule {
+	rulesOnce.Do(func() {
+		if *flagRules == "" {
+			rules = []Rule{DefaultRule}
+		} else {
+			data, err := os.ReadFile(*flagRules)
+			if err != nil {
+				log.Fatalf("gclint: reading -rules: %v", err)
+			}
+			if err := json.Unmarshal(data, &rules); err != nil {
+				log.Fatalf("gclint: parsing -rules: %v", err)
+			}
+		}
+		rules = append(rules, extraRules...)
+	})
+	return rules
+}
+
+func (r Rule) interfaceName() string { return fmt.Sprintf("%s.%s", path.Base(r.PkgPath), r.Interface) }
+func (r Rule) concreteName() string  { return fmt.Sprintf("*%s.%s", path.Base(r.PkgPath), r.Concrete) }
+
+func (r Rule) isInterface(typ types.Type) bool     { return isNamedType(typ, r.PkgPath, r.Interface) }
+func (r Rule) isPtrToConcrete(typ types.Type) bool { return isPtrToNamedType(typ, r.PkgPath, r.Concrete) }
+
+func (r Rule) isExemptPtr(typ types.Type) bool {
+	for _, name := range r.ExemptPtrTo {
+		if isPtrToNamedType(typ, r.PkgPath, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllowedField reports whether n is a selector expression referring to a
+// field listed in r.AllowedFields.
+func (r Rule) isAllowedField(n ast.Expr, info *types.Info) bool {
+	sel, ok := n.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	obj, ok := info.Uses[sel.Sel]
+	if !ok {
+		return false
+	}
+	for _, fr := range r.AllowedFields {
+		// TODO(mdempsky): This is imprecise. Should really check
+		// that obj is a field declared within r.PkgPath.fr.Type.
+		if isNamedObject(obj, r.PkgPath, fr.Field) {
+			return true
+		}
+	}
+	return false
+}
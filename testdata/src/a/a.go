@@ -0,0 +1,24 @@
+package a
+
+import "gclinttest/ir"
+
+type wrapper struct {
+	N ir.Node // want `struct field typed as ir\.Node \(likely change to \*ir\.Name\)`
+}
+
+func useMap(m map[ir.Node]int) {} // want `map with ir\.Node key \(likely change key type to \*ir\.Name\)`
+
+func compareNodes(x, y ir.Node) bool {
+	return x == y // want `comparison of ir\.Node values \(replace with ir\.Uses or ir\.SameSource\)`
+}
+
+func assertNode(n ir.Node) {
+	if m, ok := n.(*ir.Name); ok { // want `type assertion of ir\.Node to \*ir\.Name \(caller should hold \*ir\.Name directly instead\)`
+		_ = m
+	}
+	switch v := n.(type) {
+	case *ir.Name: // want `type switch case \*ir\.Name on ir\.Node value \(caller should hold \*ir\.Name directly instead\)`
+		_ = v
+	default:
+	}
+}
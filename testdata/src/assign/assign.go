@@ -0,0 +1,21 @@
+package assign
+
+import "gclinttest/ir"
+
+type wrapper struct {
+	N ir.Node // want `struct field typed as ir\.Node \(likely change to \*ir\.Name\)`
+}
+
+func toVar(n *ir.Name) ir.Node {
+	var x ir.Node
+	x = n // want `\*ir\.Name assigned to ir\.Node \(maybe change destination to \*ir\.Name too\)`
+	return x
+}
+
+func toCompositeLit(n *ir.Name) wrapper {
+	return wrapper{n} // want `\*ir\.Name assigned to ir\.Node \(maybe change destination to \*ir\.Name too\)`
+}
+
+func toKeyedCompositeLit(n *ir.Name) wrapper {
+	return wrapper{N: n} // want `\*ir\.Name assigned to ir\.Node \(maybe change destination to \*ir\.Name too\)`
+}
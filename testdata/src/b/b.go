@@ -0,0 +1,10 @@
+package b
+
+import "gclinttest/ir"
+
+// UseNode is called only with *ir.Name arguments from package c, but that
+// shouldn't cause -interproc to suggest narrowing n's declared type here:
+// this package's own files never assign it, so there's nothing to flag.
+func UseNode(n ir.Node) {
+	_ = n
+}
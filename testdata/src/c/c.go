@@ -0,0 +1,16 @@
+package c
+
+import (
+	"b"
+	"gclinttest/ir"
+)
+
+func callB(n *ir.Name) {
+	b.UseNode(n)
+}
+
+func localOnlyName(n *ir.Name) ir.Node {
+	var x ir.Node // want `x is ir\.Node but only ever assigned \*ir\.Name \(likely change its type to \*ir\.Name\)`
+	x = n
+	return x
+}
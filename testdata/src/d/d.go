@@ -0,0 +1,11 @@
+package d
+
+import "gclinttest/ir"
+
+// closureLink assigns through the Name.Defn field, the "link closure
+// variable to outer scope" pattern that AllowedFields exempts. -interproc
+// reports nothing here: Defn is declared in package ir, not in this
+// package, so it isn't tracked when analyzing this package.
+func closureLink(n, outer *ir.Name) {
+	n.Defn = outer
+}
@@ -0,0 +1,23 @@
+// Package ir is a small stand-in for cmd/compile/internal/ir, just
+// enough of the Node/Name/Func shapes for gclint's testdata fixtures to
+// exercise the default rule against.
+package ir
+
+type Node interface {
+	Pos() int
+}
+
+type Name struct {
+	Defn  Node
+	Curfn *Func
+}
+
+func (n *Name) Pos() int { return 0 }
+
+type Func struct{}
+
+func (f *Func) Pos() int { return 0 }
+
+func SameSource(a, b Node) bool { return a == b }
+
+func Uses(n Node, name *Name) bool { return false }